@@ -0,0 +1,114 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CallWatchdog guards individual function calls against running longer than
+// a configured deadline, dumping goroutine stacks and invoking an Action if
+// one is exceeded
+type CallWatchdog struct {
+	maxWait   time.Duration
+	onTimeout Action
+
+	mutex    sync.Mutex
+	counter  uint64
+	inFlight map[uint64]InFlightOp
+}
+
+// InFlightOp describes a call currently being tracked by a CallWatchdog
+type InFlightOp struct {
+	ID        uint64
+	Name      string
+	StartedAt time.Time
+}
+
+// NewCallWatchdog returns a CallWatchdog that treats any call taking longer
+// than maxWait as stuck, invoking onTimeout with the call's name
+func NewCallWatchdog(maxWait time.Duration, onTimeout func(name string)) *CallWatchdog {
+	return &CallWatchdog{
+		maxWait:   maxWait,
+		onTimeout: onTimeout,
+		inFlight:  make(map[uint64]InFlightOp),
+	}
+}
+
+// Do runs fn to completion, reporting it as stuck if it does not return
+// within maxWait. fn continues running in the background even after the
+// timeout fires, and its eventual error is discarded in that case
+func (w *CallWatchdog) Do(name string, fn func() error) error {
+	return w.DoCtx(context.Background(), name, fn)
+}
+
+// DoCtx is like Do but also returns early with ctx.Err() if ctx is done
+// before fn completes. The call stays visible in InFlight until fn actually
+// returns, even if DoCtx itself already returned due to a timeout or a done
+// ctx, so callers can keep seeing what's hung
+func (w *CallWatchdog) DoCtx(ctx context.Context, name string, fn func() error) error {
+	id := w.start(name)
+
+	done := make(chan error, 1)
+	go func() {
+		err := fn()
+		w.finish(id)
+		done <- err
+	}()
+
+	timer := time.NewTimer(w.maxWait)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		logStuck(name)
+		if w.onTimeout != nil {
+			w.onTimeout(name)
+		}
+
+		return fmt.Errorf("watchdog: call %q did not complete within %s", name, w.maxWait)
+	}
+}
+
+// start records fn as in-flight and returns its tracking ID
+func (w *CallWatchdog) start(name string) uint64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	id := atomic.AddUint64(&w.counter, 1)
+	w.inFlight[id] = InFlightOp{
+		ID:        id,
+		Name:      name,
+		StartedAt: time.Now(),
+	}
+
+	return id
+}
+
+// finish removes id from the set of in-flight calls
+func (w *CallWatchdog) finish(id uint64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	delete(w.inFlight, id)
+}
+
+// InFlight returns the calls currently being tracked, for introspection
+// when something looks hung
+func (w *CallWatchdog) InFlight() []InFlightOp {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	ops := make([]InFlightOp, 0, len(w.inFlight))
+	for _, op := range w.inFlight {
+		ops = append(ops, op)
+	}
+
+	return ops
+}
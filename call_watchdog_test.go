@@ -0,0 +1,116 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCallWatchdog_DoReturnsFnResultWithinDeadline(t *testing.T) {
+	w := NewCallWatchdog(time.Second, nil)
+
+	wantErr := errors.New("boom")
+	err := w.Do("quick", func() error {
+		return wantErr
+	})
+
+	if err != wantErr {
+		t.Fatalf("Do() = %v, want %v", err, wantErr)
+	}
+
+	if ops := w.InFlight(); len(ops) != 0 {
+		t.Fatalf("InFlight() = %v after completion, want empty", ops)
+	}
+}
+
+func TestCallWatchdog_DoTimesOutAndInvokesOnTimeout(t *testing.T) {
+	var called string
+	var mutex sync.Mutex
+	done := make(chan struct{})
+
+	w := NewCallWatchdog(10*time.Millisecond, func(name string) {
+		mutex.Lock()
+		called = name
+		mutex.Unlock()
+		close(done)
+	})
+
+	release := make(chan struct{})
+	err := w.Do("slow", func() error {
+		<-release
+		return nil
+	})
+	defer close(release)
+
+	if err == nil {
+		t.Fatal("Do() = nil, want a timeout error")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("onTimeout was not invoked")
+	}
+
+	mutex.Lock()
+	got := called
+	mutex.Unlock()
+
+	if got != "slow" {
+		t.Fatalf("onTimeout called with %q, want %q", got, "slow")
+	}
+}
+
+func TestCallWatchdog_InFlightStaysVisibleUntilCallActuallyCompletes(t *testing.T) {
+	w := NewCallWatchdog(10*time.Millisecond, nil)
+
+	release := make(chan struct{})
+	go w.Do("hung", func() error {
+		<-release
+		return nil
+	})
+
+	// give Do time to register and time out
+	time.Sleep(50 * time.Millisecond)
+
+	ops := w.InFlight()
+	if len(ops) != 1 || ops[0].Name != "hung" {
+		t.Fatalf("InFlight() = %+v after timeout, want a single entry for %q", ops, "hung")
+	}
+
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+
+	if ops := w.InFlight(); len(ops) != 0 {
+		t.Fatalf("InFlight() = %+v after the call actually completed, want empty", ops)
+	}
+}
+
+func TestCallWatchdog_DoCtxReturnsEarlyWhenContextDone(t *testing.T) {
+	w := NewCallWatchdog(time.Second, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- w.DoCtx(ctx, "cancellable", func() error {
+			<-release
+			return nil
+		})
+	}()
+
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Fatalf("DoCtx() = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("DoCtx() did not return after ctx was canceled")
+	}
+}
@@ -0,0 +1,118 @@
+package watchdog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileWatchdogService whacks itself whenever one of a set of watched files
+// or directories changes, so the watchdog fails if those paths stop being
+// touched within duration. This suits things like slideshow/asset
+// directories, log rotation liveness, and config-reload triggers
+type FileWatchdogService struct {
+	name  string
+	inner WatchdogService
+
+	debounce time.Duration
+
+	mutex     sync.Mutex
+	lastWhack time.Time
+
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// NewFileWatchdogService watches paths for create/write/remove/rename
+// events and whacks itself whenever one occurs, failing Check if duration
+// passes without any such event. debounce, if non-zero, ignores events that
+// arrive less than debounce after the previous accepted one
+func NewFileWatchdogService(name string, duration time.Duration, debounce time.Duration, paths ...string) (*FileWatchdogService, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("watchdog: creating file watcher for %q: %w", name, err)
+	}
+
+	for _, path := range paths {
+		if err := watcher.Add(path); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("watchdog: watching %s for %q: %w", path, name, err)
+		}
+	}
+
+	s := &FileWatchdogService{
+		name:     name,
+		inner:    TimeWatchdogService(name, duration),
+		debounce: debounce,
+		watcher:  watcher,
+		done:     make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// run consumes filesystem events until Terminate is called
+func (s *FileWatchdogService) run() {
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+
+			s.onEvent(event)
+		case _, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// onEvent whacks the service, applying the configured debounce
+func (s *FileWatchdogService) onEvent(event fsnotify.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if s.debounce > 0 && now.Sub(s.lastWhack) < s.debounce {
+		return
+	}
+
+	s.lastWhack = now
+	s.inner.Whack()
+}
+
+// Name returns the name of the service
+func (s *FileWatchdogService) Name() string {
+	return s.name
+}
+
+// Whack resets the service for its configured duration, as if a watched
+// file had just changed
+func (s *FileWatchdogService) Whack() {
+	s.inner.Whack()
+}
+
+// Check checks if the service has gone too long without a watched file
+// changing
+func (s *FileWatchdogService) Check() bool {
+	return s.inner.Check()
+}
+
+// Terminate stops watching the filesystem and releases the underlying
+// fsnotify watcher
+func (s *FileWatchdogService) Terminate() {
+	close(s.done)
+	s.watcher.Close()
+}
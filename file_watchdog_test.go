@@ -0,0 +1,79 @@
+package watchdog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileWatchdogService_WhacksOnFileChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "touched")
+	if err := os.WriteFile(path, []byte("initial"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	s, err := NewFileWatchdogService("files", 50*time.Millisecond, 0, dir)
+	if err != nil {
+		t.Fatalf("NewFileWatchdogService: %v", err)
+	}
+	defer s.Terminate()
+
+	if !s.Check() {
+		t.Fatal("Check() = false immediately after construction, want true")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("changed"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !s.Check() {
+		t.Fatal("Check() = false after a watched file changed within duration, want true")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if s.Check() {
+		t.Fatal("Check() = true after duration passed with no further changes, want false")
+	}
+}
+
+func TestFileWatchdogService_DebounceIgnoresRapidEvents(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "touched")
+	if err := os.WriteFile(path, []byte("initial"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	s, err := NewFileWatchdogService("files", time.Hour, time.Hour, dir)
+	if err != nil {
+		t.Fatalf("NewFileWatchdogService: %v", err)
+	}
+	defer s.Terminate()
+
+	// the first event is always accepted, seeding lastWhack
+	if err := os.WriteFile(path, []byte("first change"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	s.mutex.Lock()
+	before := s.lastWhack
+	s.mutex.Unlock()
+
+	// a second event arriving well within the debounce window is ignored
+	if err := os.WriteFile(path, []byte("second change"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	s.mutex.Lock()
+	after := s.lastWhack
+	s.mutex.Unlock()
+
+	if !after.Equal(before) {
+		t.Fatalf("lastWhack changed to %v despite a 1h debounce, want unchanged from %v", after, before)
+	}
+}
@@ -0,0 +1,114 @@
+//go:build linux
+
+package watchdog
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Linux watchdog ioctl numbers, from <linux/watchdog.h>
+const (
+	wdiocGetSupport    = 0x80285700
+	wdiocGetStatus     = 0x80045701
+	wdiocGetBootStatus = 0x80045702
+	wdiocSetOptions    = 0x80045704
+	wdiocKeepalive     = 0x80045705
+	wdiocSetTimeout    = 0xc0045706
+	wdiocGetTimeout    = 0x80045707
+)
+
+// defaultHardwareWatchdogPath is the device opened when no path is given
+const defaultHardwareWatchdogPath = "/dev/watchdog0"
+
+// WatchdogInfo mirrors struct watchdog_info from <linux/watchdog.h>
+type WatchdogInfo struct {
+	Options         uint32
+	FirmwareVersion uint32
+	Identity        [32]byte
+}
+
+// HardwareWatchdogService pings a kernel watchdog timer exposed at a device
+// such as /dev/watchdog0, so that a wedged process triggers a hardware reset
+type HardwareWatchdogService struct {
+	name string
+	file *os.File
+}
+
+// NewHardwareWatchdogService opens path (e.g. /dev/watchdog0) and sets its
+// timeout, so that subsequent Whack calls keep the hardware timer alive
+func NewHardwareWatchdogService(path string, timeout time.Duration) (*HardwareWatchdogService, error) {
+	if path == "" {
+		path = defaultHardwareWatchdogPath
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("watchdog: opening %s: %w", path, err)
+	}
+
+	s := &HardwareWatchdogService{
+		name: path,
+		file: file,
+	}
+
+	seconds := int32(timeout.Seconds())
+	if err := s.ioctl(wdiocSetTimeout, uintptr(unsafe.Pointer(&seconds))); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("watchdog: setting timeout on %s: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// Name returns the path of the underlying watchdog device
+func (s *HardwareWatchdogService) Name() string {
+	return s.name
+}
+
+// Whack pings the kernel watchdog to prevent it from firing
+func (s *HardwareWatchdogService) Whack() {
+	var dummy int32
+	s.ioctl(wdiocKeepalive, uintptr(unsafe.Pointer(&dummy)))
+}
+
+// Check always reports healthy: liveness here is enforced by the kernel
+// timer itself rather than anything this process can observe
+func (s *HardwareWatchdogService) Check() bool {
+	return true
+}
+
+// Terminate issues the magic-close byte "V" and closes the device, so the
+// board does not reset purely because the process exited gracefully
+func (s *HardwareWatchdogService) Terminate() {
+	s.file.Write([]byte("V"))
+	s.file.Close()
+}
+
+// GetSupport returns the watchdog device's identity and supported options
+func (s *HardwareWatchdogService) GetSupport() (WatchdogInfo, error) {
+	var info WatchdogInfo
+	err := s.ioctl(wdiocGetSupport, uintptr(unsafe.Pointer(&info)))
+	return info, err
+}
+
+// GetBootStatus returns the reason for the last boot, as reported by the
+// watchdog hardware (e.g. whether it was caused by a watchdog timeout)
+func (s *HardwareWatchdogService) GetBootStatus() (uint32, error) {
+	var status uint32
+	err := s.ioctl(wdiocGetBootStatus, uintptr(unsafe.Pointer(&status)))
+	return status, err
+}
+
+// ioctl issues request against the underlying device file descriptor
+func (s *HardwareWatchdogService) ioctl(request, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, s.file.Fd(), request, arg)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+//go:build !linux
+
+package watchdog
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrHardwareWatchdogUnsupported is returned on platforms without a kernel
+// watchdog device interface
+var ErrHardwareWatchdogUnsupported = errors.New("watchdog: hardware watchdog is only supported on linux")
+
+// HardwareWatchdogService is a stub on non-Linux platforms, where there is
+// no /dev/watchdogN device to ping
+type HardwareWatchdogService struct{}
+
+// NewHardwareWatchdogService always fails on non-Linux platforms
+func NewHardwareWatchdogService(path string, timeout time.Duration) (*HardwareWatchdogService, error) {
+	return nil, ErrHardwareWatchdogUnsupported
+}
+
+// Name returns an empty string, as no device is ever opened
+func (s *HardwareWatchdogService) Name() string {
+	return ""
+}
+
+// Whack is a no-op on non-Linux platforms
+func (s *HardwareWatchdogService) Whack() {}
+
+// Check always reports healthy, as there is nothing to check
+func (s *HardwareWatchdogService) Check() bool {
+	return true
+}
+
+// Terminate is a no-op on non-Linux platforms
+func (s *HardwareWatchdogService) Terminate() {}
@@ -1,7 +1,11 @@
 package watchdog
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"math/rand"
+	"runtime/pprof"
 	"sync"
 	"time"
 )
@@ -15,17 +19,151 @@ type WatchdogService interface {
 
 // WatchdogSystem allows one to watch a set of services
 type WatchdogSystem interface {
-	Add(s Service)
-	Remove(s Service)
+	Add(s WatchdogService)
+	Remove(s WatchdogService)
 	Check() error
 	Watch(period time.Duration) error
+
+	// WatchContext is like Watch, but stops early if ctx is done and accepts
+	// WatchOptions such as WithJitter
+	WatchContext(ctx context.Context, period time.Duration, opts ...WatchOption) error
+
+	// Terminate stops Watch/WatchContext. It is safe to call more than once
 	Terminate()
+
+	// SetAction sets the default action taken when a service is found to be stuck
+	SetAction(action Action)
+
+	// SetServiceAction sets the action taken when the named service is found to be
+	// stuck, overriding the default action for that service only
+	SetServiceAction(name string, action Action)
+
+	// SetRenotifyInterval sets how often a service that remains stuck is
+	// re-reported. The default is 60 seconds
+	SetRenotifyInterval(d time.Duration)
+
+	// Subscribe returns a channel of state-transition events for all
+	// services, and a cancel func to stop receiving them. Slow consumers
+	// have events dropped rather than blocking Check/Watch
+	Subscribe() (<-chan Event, func())
+}
+
+// State is the lifecycle state of a watched service
+type State int
+
+const (
+	// Healthy means the service last passed Check
+	Healthy State = iota
+	// Expired means the service last failed Check
+	Expired
+	// Recovered means the service failed Check and has now passed it again
+	Recovered
+	// Added means the service was just added to the system
+	Added
+	// Removed means the service was just removed from the system
+	Removed
+)
+
+// String returns a human-readable name for the state
+func (s State) String() string {
+	switch s {
+	case Healthy:
+		return "Healthy"
+	case Expired:
+		return "Expired"
+	case Recovered:
+		return "Recovered"
+	case Added:
+		return "Added"
+	case Removed:
+		return "Removed"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event describes a single service transitioning from OldState to NewState
+type Event struct {
+	ServiceName string
+	OldState    State
+	NewState    State
+	At          time.Time
+}
+
+// eventBufferSize is the per-subscriber channel buffer. Once full, further
+// events for that subscriber are dropped rather than blocking the watch loop
+const eventBufferSize = 16
+
+// WatchOption configures a single Watch/WatchContext call
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	jitterFraction float64
+}
+
+// WithJitter randomizes each tick by up to ±fraction of period (e.g. 0.1 for
+// ±10%), so that many watchdogs sharing the same period don't all wake, and
+// hit Check, at exactly the same time
+func WithJitter(fraction float64) WatchOption {
+	return func(o *watchOptions) {
+		o.jitterFraction = fraction
+	}
+}
+
+// jitteredPeriod returns period randomized by up to ±fraction
+func jitteredPeriod(period time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return period
+	}
+
+	delta := (rand.Float64()*2 - 1) * fraction
+	return time.Duration(float64(period) * (1 + delta))
+}
+
+// Action is invoked with the name of a service once it is found to be stuck
+type Action func(name string)
+
+// LogWarningAction returns an Action that logs a warning and dumps all
+// goroutine stacks, but otherwise lets the process continue running
+func LogWarningAction() Action {
+	return func(name string) {
+		logStuck(name)
+	}
 }
 
+// PanicAction returns an Action that logs a warning, dumps all goroutine
+// stacks, and then panics
+func PanicAction() Action {
+	return func(name string) {
+		logStuck(name)
+		panic(fmt.Sprintf("watchdog: service %q is stuck", name))
+	}
+}
+
+// CallbackAction returns an Action that invokes fn with the name of the
+// stuck service, e.g. to call os.Exit or restart a subprocess
+func CallbackAction(fn func(name string)) Action {
+	return fn
+}
+
+// logStuck prints a warning for the named service along with a full dump of
+// all goroutine stacks, to help diagnose what it is stuck on
+func logStuck(name string) {
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 2)
+
+	fmt.Printf("watchdog: warning: service %q appears to be stuck\n%s\n", name, buf.String())
+}
+
+// defaultRenotifyInterval is how often a still-stuck service is re-reported
+const defaultRenotifyInterval = 60 * time.Second
+
 // timeWatchdogService implements a time-based watchdog check
 type timeWatchdogService struct {
 	name     string
 	duration time.Duration
+
+	mutex    sync.Mutex
 	expireAt time.Time
 }
 
@@ -48,63 +186,212 @@ func (s *timeWatchdogService) Name() string {
 
 // Whatck resets the service for its configured duration
 func (s *timeWatchdogService) Whack() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	s.expireAt = time.Now().Add(s.duration)
 }
 
 // Check checks if the service Whack time has expired
 func (s *timeWatchdogService) Check() bool {
-	return time.Now().After(s.expireAt)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return !time.Now().After(s.expireAt)
 }
 
 // mapWatchdogSystem implements a system of managing watchdog services using a map
 type mapWatchdogSystem struct {
-	terminated bool
-	mutex      *sync.Mutex
-	services   map[string]WatchdogService
+	mutex    sync.RWMutex
+	services map[string]WatchdogService
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	action           Action
+	serviceActions   map[string]Action
+	renotifyInterval time.Duration
+	stuckSince       map[string]time.Time
+	lastNotified     map[string]time.Time
+
+	serviceState map[string]State
+	subscribers  map[int]chan Event
+	nextSubID    int
 }
 
 // MapWatchdogSystem returns a new watchdog system implemented using maps
-func MapWatchdogSystem() Watchdog {
-	w := timeWatchdog{
-		terminated: false,
-		mutex:      new(sync.Mutex),
-		services:   make(map[string]WatchdogService),
+func MapWatchdogSystem() WatchdogSystem {
+	w := mapWatchdogSystem{
+		services:         make(map[string]WatchdogService),
+		done:             make(chan struct{}),
+		serviceActions:   make(map[string]Action),
+		renotifyInterval: defaultRenotifyInterval,
+		stuckSince:       make(map[string]time.Time),
+		lastNotified:     make(map[string]time.Time),
+		serviceState:     make(map[string]State),
+		subscribers:      make(map[int]chan Event),
 	}
 
 	return &w
 }
 
 // Add adds a service to the list of services checked
-func (w *mapWatchdogSystem) Add(s Service) {
+func (w *mapWatchdogSystem) Add(s WatchdogService) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	w.timeouts[s.Name()] = s
+	w.services[s.Name()] = s
+
+	w.publish(Event{ServiceName: s.Name(), OldState: Healthy, NewState: Added, At: time.Now()})
 }
 
 // Remove removes a service from the list of services checked
-func (w *mapWatchdogSystem) Remove(s Service) {
+func (w *mapWatchdogSystem) Remove(s WatchdogService) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	old := w.serviceState[s.Name()]
+
+	delete(w.services, s.Name())
+	delete(w.serviceState, s.Name())
+
+	w.publish(Event{ServiceName: s.Name(), OldState: old, NewState: Removed, At: time.Now()})
+}
+
+// Subscribe registers a new listener for service state-transition events.
+// The returned cancel func must be called to stop receiving events and free
+// the underlying channel
+func (w *mapWatchdogSystem) Subscribe() (<-chan Event, func()) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	delete(w.timeouts, s.Name())
+	id := w.nextSubID
+	w.nextSubID++
+
+	ch := make(chan Event, eventBufferSize)
+	w.subscribers[id] = ch
+
+	cancel := func() {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		delete(w.subscribers, id)
+		close(ch)
+	}
+
+	return ch, cancel
+}
+
+// publish fans event out to all subscribers, dropping it for any whose
+// channel is full rather than blocking the caller
+func (w *mapWatchdogSystem) publish(event Event) {
+	for id, ch := range w.subscribers {
+		select {
+		case ch <- event:
+		default:
+			fmt.Printf("watchdog: warning: subscriber %d is too slow, dropping event for service %q\n", id, event.ServiceName)
+		}
+	}
+}
+
+// SetAction sets the default action taken when a service is found to be stuck
+func (w *mapWatchdogSystem) SetAction(action Action) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.action = action
+}
+
+// SetServiceAction sets the action taken when the named service is found to be
+// stuck, overriding the default action for that service only
+func (w *mapWatchdogSystem) SetServiceAction(name string, action Action) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.serviceActions[name] = action
+}
+
+// SetRenotifyInterval sets how often a service that remains stuck is re-reported
+func (w *mapWatchdogSystem) SetRenotifyInterval(d time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.renotifyInterval = d
+}
+
+// dueNotification pairs a stuck service with the action to run for it,
+// resolved while the lock is held so it can be invoked after releasing it
+type dueNotification struct {
+	name   string
+	action Action
 }
 
 // Check checks all services for faults
 func (w *mapWatchdogSystem) Check() error {
 	w.mutex.Lock()
-	defer w.mutex.Unlock()
 
 	errors := ""
+	now := time.Now()
+	var due []dueNotification
 
 	for name, service := range w.services {
+		old := w.serviceState[name]
+
 		if !service.Check() {
 			if errors != "" {
 				errors = errors + ", "
 			}
 
 			errors += name
+
+			if _, known := w.stuckSince[name]; !known {
+				w.stuckSince[name] = now
+			}
+
+			if old != Expired {
+				w.serviceState[name] = Expired
+				w.publish(Event{ServiceName: name, OldState: old, NewState: Expired, At: now})
+			}
+
+			continue
 		}
+
+		delete(w.stuckSince, name)
+		delete(w.lastNotified, name)
+
+		if old == Expired {
+			w.serviceState[name] = Recovered
+			w.publish(Event{ServiceName: name, OldState: old, NewState: Recovered, At: now})
+		} else if old != Healthy {
+			w.serviceState[name] = Healthy
+		}
+	}
+
+	if errors != "" {
+		for name := range w.stuckSince {
+			last, notified := w.lastNotified[name]
+			isDue := !notified || now.Sub(last) >= w.renotifyInterval
+
+			if !isDue {
+				continue
+			}
+
+			due = append(due, dueNotification{name: name, action: w.resolveAction(name)})
+			w.lastNotified[name] = now
+		}
+	}
+
+	w.mutex.Unlock()
+
+	// Actions are invoked outside the lock: a CallbackAction may reasonably
+	// want to call back into the WatchdogSystem (e.g. Add a replacement
+	// service), which would deadlock on the non-reentrant mutex otherwise
+	for _, n := range due {
+		if n.action == nil {
+			continue
+		}
+
+		n.action(n.name)
 	}
 
 	if errors != "" {
@@ -114,23 +401,55 @@ func (w *mapWatchdogSystem) Check() error {
 	return nil
 }
 
+// resolveAction returns the action configured for name, preferring a
+// per-service action over the system default. Must be called with the lock held
+func (w *mapWatchdogSystem) resolveAction(name string) Action {
+	action := w.action
+	if serviceAction, ok := w.serviceActions[name]; ok {
+		action = serviceAction
+	}
+
+	return action
+}
+
 // Watch continually watches the services until it terminates or there is a failure. This should run in a goroutine
 func (w *mapWatchdogSystem) Watch(period time.Duration) error {
+	return w.WatchContext(context.Background(), period)
+}
+
+// WatchContext is like Watch, but also stops early if ctx is done, and
+// accepts WatchOptions such as WithJitter. This should run in a goroutine
+func (w *mapWatchdogSystem) WatchContext(ctx context.Context, period time.Duration, opts ...WatchOption) error {
+	var o watchOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ticker := time.NewTicker(jitteredPeriod(period, o.jitterFraction))
+	defer ticker.Stop()
+
 	for {
-		if w.terminated {
+		select {
+		case <-w.done:
 			return nil
-		}
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.Check(); err != nil {
+				return err
+			}
 
-		err := w.Check()
-		if err != nil {
-			return err
+			if o.jitterFraction > 0 {
+				ticker.Reset(jitteredPeriod(period, o.jitterFraction))
+			}
 		}
-
-		time.Sleep(period)
 	}
 }
 
-// Terminate terminates the Watch method.
+// Terminate stops Watch/WatchContext. It is idempotent: calling it more
+// than once, including concurrently, is safe.
 func (w *mapWatchdogSystem) Terminate() {
-	w.terminated = true
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
 }
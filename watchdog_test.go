@@ -0,0 +1,301 @@
+package watchdog
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMapWatchdogSystem_ConcurrentAddRemoveCheckTerminate(t *testing.T) {
+	tests := []struct {
+		name       string
+		numWorkers int
+	}{
+		{name: "single worker", numWorkers: 1},
+		{name: "many workers", numWorkers: 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := MapWatchdogSystem()
+
+			var wg sync.WaitGroup
+			for i := 0; i < tt.numWorkers; i++ {
+				wg.Add(1)
+
+				go func(i int) {
+					defer wg.Done()
+
+					s := TimeWatchdogService("service", time.Hour)
+					for j := 0; j < 100; j++ {
+						w.Add(s)
+						w.Check()
+						s.Whack()
+						w.Remove(s)
+					}
+
+					w.Terminate()
+				}(i)
+			}
+
+			wg.Wait()
+
+			if err := w.Check(); err != nil {
+				t.Fatalf("Check() after workers finished: %v", err)
+			}
+
+			w.Terminate()
+		})
+	}
+}
+
+func TestMapWatchdogSystem_TerminateIsIdempotent(t *testing.T) {
+	w := MapWatchdogSystem()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			w.Terminate()
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestMapWatchdogSystem_WatchContextStopsOnTerminate(t *testing.T) {
+	w := MapWatchdogSystem()
+	w.Add(TimeWatchdogService("service", time.Hour))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Watch(10 * time.Millisecond)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	w.Terminate()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Watch() returned %v, want nil after Terminate", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch() did not return after Terminate")
+	}
+}
+
+func TestMapWatchdogSystem_CheckReportsExpiredService(t *testing.T) {
+	w := MapWatchdogSystem()
+	w.Add(TimeWatchdogService("expires-fast", time.Millisecond))
+
+	time.Sleep(10 * time.Millisecond)
+
+	if err := w.Check(); err == nil {
+		t.Fatal("Check() = nil, want an error for an expired service")
+	}
+}
+
+func TestMapWatchdogSystem_SubscribeFansOutToAllSubscribers(t *testing.T) {
+	w := MapWatchdogSystem()
+
+	ch1, cancel1 := w.Subscribe()
+	defer cancel1()
+	ch2, cancel2 := w.Subscribe()
+	defer cancel2()
+
+	w.Add(TimeWatchdogService("service", time.Hour))
+
+	for _, ch := range []<-chan Event{ch1, ch2} {
+		select {
+		case event := <-ch:
+			if event.ServiceName != "service" || event.NewState != Added {
+				t.Fatalf("got %+v, want Added event for %q", event, "service")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("subscriber did not receive Added event")
+		}
+	}
+}
+
+func TestMapWatchdogSystem_SubscribeReportsExpiredRecoveredAndRemoved(t *testing.T) {
+	w := MapWatchdogSystem()
+	ch, cancel := w.Subscribe()
+	defer cancel()
+
+	s := TimeWatchdogService("service", time.Millisecond)
+	w.Add(s)
+	drainEvent(t, ch, Added)
+
+	time.Sleep(10 * time.Millisecond)
+	w.Check()
+	drainEvent(t, ch, Expired)
+
+	s.Whack()
+	w.Check()
+	drainEvent(t, ch, Recovered)
+
+	w.Remove(s)
+	event := drainEvent(t, ch, Removed)
+	if event.OldState != Recovered {
+		t.Fatalf("Removed event OldState = %v, want Recovered (the service's last known state)", event.OldState)
+	}
+}
+
+func TestMapWatchdogSystem_SubscribeDropsEventsForSlowConsumer(t *testing.T) {
+	w := MapWatchdogSystem()
+	ch, cancel := w.Subscribe()
+	defer cancel()
+
+	for i := 0; i < eventBufferSize+10; i++ {
+		w.Add(TimeWatchdogService(fmt.Sprintf("service-%d", i), time.Hour))
+	}
+
+	if len(ch) != eventBufferSize {
+		t.Fatalf("subscriber channel has %d buffered events, want %d (excess should be dropped)", len(ch), eventBufferSize)
+	}
+}
+
+func TestMapWatchdogSystem_CheckInvokesActionsOutsideTheLock(t *testing.T) {
+	w := MapWatchdogSystem()
+	w.Add(TimeWatchdogService("stuck", time.Millisecond))
+
+	done := make(chan struct{})
+	w.SetAction(CallbackAction(func(name string) {
+		// A callback that calls back into the system must not deadlock,
+		// even though it runs from inside Check()
+		w.Add(TimeWatchdogService("replacement", time.Hour))
+		close(done)
+	}))
+
+	time.Sleep(10 * time.Millisecond)
+	w.Check()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Check() deadlocked calling an Action that re-entered the WatchdogSystem")
+	}
+}
+
+func TestMapWatchdogSystem_SetServiceActionOverridesDefault(t *testing.T) {
+	w := MapWatchdogSystem()
+	w.Add(TimeWatchdogService("a", time.Millisecond))
+	w.Add(TimeWatchdogService("b", time.Millisecond))
+
+	var defaultCalls, serviceCalls []string
+	var mutex sync.Mutex
+
+	w.SetAction(CallbackAction(func(name string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		defaultCalls = append(defaultCalls, name)
+	}))
+	w.SetServiceAction("b", CallbackAction(func(name string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		serviceCalls = append(serviceCalls, name)
+	}))
+
+	time.Sleep(10 * time.Millisecond)
+	w.Check()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(defaultCalls) != 1 || defaultCalls[0] != "a" {
+		t.Fatalf("defaultCalls = %v, want [a]", defaultCalls)
+	}
+	if len(serviceCalls) != 1 || serviceCalls[0] != "b" {
+		t.Fatalf("serviceCalls = %v, want [b]", serviceCalls)
+	}
+}
+
+func TestMapWatchdogSystem_RenotifySuppressesThenFiresAfterInterval(t *testing.T) {
+	w := MapWatchdogSystem()
+	w.SetRenotifyInterval(50 * time.Millisecond)
+
+	var calls int
+	var mutex sync.Mutex
+	w.SetAction(CallbackAction(func(name string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls++
+	}))
+
+	w.Add(TimeWatchdogService("stuck", time.Millisecond))
+	time.Sleep(10 * time.Millisecond)
+
+	w.Check() // first Check after going stuck: always notifies
+	w.Check() // immediately after: should be suppressed
+	w.Check() // still within the renotify interval: should be suppressed
+
+	mutex.Lock()
+	got := calls
+	mutex.Unlock()
+
+	if got != 1 {
+		t.Fatalf("calls = %d after 3 Checks within the renotify interval, want 1", got)
+	}
+
+	time.Sleep(60 * time.Millisecond) // past the renotify interval
+	w.Check()
+
+	mutex.Lock()
+	got = calls
+	mutex.Unlock()
+
+	if got != 2 {
+		t.Fatalf("calls = %d after the renotify interval elapsed, want 2", got)
+	}
+}
+
+func TestMapWatchdogSystem_RenotifyDoesNotFireEarlyForOtherStuckServices(t *testing.T) {
+	w := MapWatchdogSystem()
+	w.SetRenotifyInterval(time.Hour)
+
+	var calls []string
+	var mutex sync.Mutex
+	w.SetAction(CallbackAction(func(name string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls = append(calls, name)
+	}))
+
+	a := TimeWatchdogService("a", time.Millisecond)
+	w.Add(a)
+	time.Sleep(10 * time.Millisecond)
+	w.Check() // a becomes stuck: 1 notification
+
+	w.Add(TimeWatchdogService("b", time.Millisecond))
+	time.Sleep(10 * time.Millisecond)
+	w.Check() // b becomes newly stuck: should notify only for b, not re-notify a
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(calls) != 2 || calls[0] != "a" || calls[1] != "b" {
+		t.Fatalf("calls = %v, want [a b] with a notified exactly once", calls)
+	}
+}
+
+// drainEvent reads the next event from ch and fails the test if it isn't in
+// the expected new state
+func drainEvent(t *testing.T, ch <-chan Event, want State) Event {
+	t.Helper()
+
+	select {
+	case event := <-ch:
+		if event.NewState != want {
+			t.Fatalf("got event %+v, want NewState %v", event, want)
+		}
+
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for a %v event", want)
+		return Event{}
+	}
+}